@@ -11,15 +11,17 @@ import (
 	"github.com/jawher/mow.cli"
 	"github.com/k-takata/go-iscygpty"
 	"github.com/mattn/go-isatty"
+
+	"github.com/raoulh/babymonitor/pkg/config"
 )
 
 const (
-	CharStar     = "\u2737"
-	CharAbort    = "\u2718"
-	CharCheck    = "\u2714"
-	CharWarning  = "\u26A0"
-	CharArrow    = "\u2012\u25b6"
-	CharVertLine = "\u2502"
+	CharStar     = "✷"
+	CharAbort    = "✘"
+	CharCheck    = "✔"
+	CharWarning  = "⚠"
+	CharArrow    = "‒▶"
+	CharVertLine = "│"
 )
 
 var (
@@ -44,7 +46,7 @@ func exit(err error, exit int) {
 func main() {
 	runtime.GOMAXPROCS(runtime.NumCPU())
 
-	// fix for cygwin terminal
+	//fix for cygwin terminal
 	if iscygpty.IsCygwinPty(os.Stdout.Fd()) || isatty.IsTerminal(os.Stdout.Fd()) {
 		isTerminal = true
 	}
@@ -54,12 +56,12 @@ func main() {
 	optConfig = app.StringArg("CONFIG", "babymonitor.conf", "Config file to use")
 	app.Spec = "[CONFIG]"
 	app.Action = func() {
-		err := readConfig(*optConfig)
+		cfg, err := config.Load(*optConfig)
 		if err != nil {
 			exit(err, 1)
 		}
 
-		err = startBabymonitor()
+		err = run(cfg)
 		if err != nil {
 			exit(err, 1)
 		}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/binary"
+	"log"
+	"math"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/template"
+
+	"golang.org/x/net/context"
+
+	"github.com/mattn/go-isatty"
+	"github.com/nsf/termbox-go"
+	"github.com/raoulh/go-progress"
+
+	"github.com/raoulh/babymonitor/pkg/audio"
+	"github.com/raoulh/babymonitor/pkg/config"
+	"github.com/raoulh/babymonitor/pkg/encoder"
+	"github.com/raoulh/babymonitor/pkg/stream"
+	"github.com/raoulh/babymonitor/pkg/trigger"
+)
+
+var hostApiTmpl = template.Must(template.New("").Parse(
+	`{{. | len}} host APIs: {{range .}}
+	Name:                   {{.Name}}
+	{{if .DefaultInputDevice}}Default input device:   {{.DefaultInputDevice.Name}}{{end}}
+	{{if .DefaultOutputDevice}}Default output device:  {{.DefaultOutputDevice.Name}}{{end}}
+	Devices: {{range .Devices}}
+		Name:                      {{.Name}}
+		MaxInputChannels:          {{.MaxInputChannels}}
+		MaxOutputChannels:         {{.MaxOutputChannels}}
+		DefaultLowInputLatency:    {{.DefaultLowInputLatency}}
+		DefaultLowOutputLatency:   {{.DefaultLowOutputLatency}}
+		DefaultHighInputLatency:   {{.DefaultHighInputLatency}}
+		DefaultHighOutputLatency:  {{.DefaultHighOutputLatency}}
+		DefaultSampleRate:         {{.DefaultSampleRate}}
+	{{end}}
+{{end}}`,
+))
+
+// run wires together the audio capture, streaming server and level trigger
+// and drives them until the user quits (Esc or SIGINT/SIGTERM).
+func run(cfg *config.Config) (err error) {
+	log.Printf("%s Starting baby monitor...", CharStar)
+
+	if err = termbox.Init(); err != nil {
+		panic(err)
+	}
+	termbox.SetInputMode(termbox.InputEsc)
+
+	if err = audio.Init(); err != nil {
+		return err
+	}
+	defer audio.Terminate()
+
+	hostAPIs, err := audio.HostAPIs()
+	if err != nil {
+		return err
+	}
+	if err = hostApiTmpl.Execute(os.Stdout, hostAPIs); err != nil {
+		return err
+	}
+
+	capturer, err := audio.New(cfg.AudioInput)
+	if err != nil {
+		return err
+	}
+	defer capturer.Close()
+
+	var debugWav, debugMp3 encoder.Encoder
+	if cfg.DebugWav.Enabled {
+		waveFile, err := os.Create(cfg.DebugWav.Filename)
+		if err != nil {
+			return err
+		}
+		defer waveFile.Close()
+
+		debugWav, err = encoder.New("wav", waveFile, encoder.Params{SampleRate: capturer.SampleRate})
+		if err != nil {
+			return err
+		}
+		defer debugWav.Close()
+	}
+
+	if cfg.DebugMp3.Enabled {
+		mp3File, err := os.Create(cfg.DebugMp3.Filename)
+		if err != nil {
+			return err
+		}
+		defer mp3File.Close()
+
+		debugMp3, err = encoder.New("mp3", mp3File, encoder.Params{SampleRate: capturer.SampleRate, Quality: cfg.Mp3LameQuality})
+		if err != nil {
+			return err
+		}
+		defer debugMp3.Close()
+	}
+
+	streamSrv, err := stream.New(cfg.Mounts, capturer.SampleRate, cfg.HttpPort, cfg.PublicUrl)
+	if err != nil {
+		return err
+	}
+
+	detector, err := trigger.New(cfg.LevelTrigger, cfg.Actions, cfg.TriggerPauseSec, capturer.SampleRate, streamSrv.ClipURL)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		if err := streamSrv.Run(ctx); err != nil {
+			log.Println("Streaming server stopped:", err)
+		}
+	}()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+
+	keyChan := make(chan int)
+	go func() {
+	termMainLoop:
+		for {
+			switch ev := termbox.PollEvent(); ev.Type {
+			case termbox.EventKey:
+				switch ev.Key {
+				case termbox.KeyEsc:
+					keyChan <- 1
+					break termMainLoop
+				}
+
+			case termbox.EventError:
+				panic(ev.Err)
+
+			case termbox.EventInterrupt:
+				break termMainLoop
+			}
+		}
+	}()
+
+	var bar *progress.ProgressBar
+	if isatty.IsTerminal(os.Stdout.Fd()) {
+		bar = progress.New(1000)
+		bar.Format = progress.ProgressFormats[8]
+	}
+
+	readErr := capturer.Run(ctx, func(frame []int16) error {
+		if cfg.DebugWav.Enabled {
+			if err := binary.Write(debugWav, binary.LittleEndian, frame); err != nil {
+				return err
+			}
+		}
+
+		if cfg.DebugMp3.Enabled {
+			if err := binary.Write(debugMp3, binary.LittleEndian, frame); err != nil {
+				return err
+			}
+		}
+
+		//Fan out the PCM frame to every mount's encoder goroutine. Each mount
+		//buffers independently, so a slow codec (or its slow clients) can
+		//never stall this loop or the other mounts.
+		streamSrv.WritePCM(frame)
+
+		//if we are on a terminal display a nice level bar
+		if bar != nil {
+			var mean uint64
+			for _, v := range frame {
+				if v < 0 {
+					v = -v //Abs
+				}
+				mean += uint64(v)
+			}
+			mean /= uint64(len(frame))
+			mean = mean * 1000 / math.MaxInt16
+			bar.Set(int(mean))
+		}
+
+		//Check for level trigger
+		detector.Process(frame)
+
+		select {
+		case <-sig:
+			log.Println("SIGTERM catched")
+			cancel()
+		case <-keyChan:
+			cancel()
+		default:
+		}
+
+		return nil
+	})
+	if readErr != nil {
+		log.Println("Failed to read stream:", readErr)
+	}
+
+	termbox.Interrupt()
+	termbox.Close()
+
+	log.Println("Stop. Cleaning...")
+
+	return nil
+}
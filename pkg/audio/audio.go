@@ -0,0 +1,226 @@
+// Package audio captures microphone input via portaudio and downmixes it
+// (whatever its channel count and native sample format) into mono int16
+// frames for the rest of the pipeline.
+package audio
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strings"
+
+	"golang.org/x/net/context"
+
+	"github.com/gordonklaus/portaudio"
+
+	"github.com/raoulh/babymonitor/pkg/config"
+)
+
+// defaultSampleRate is used when audio_input.sample_rate is not set
+const defaultSampleRate = 44100
+
+// SamplesCount is the number of samples read from the device each time;
+// every onFrame call passed to (*Capturer).Run carries this many samples.
+const SamplesCount = 128
+
+// Init must be called once, before HostAPIs or New, and Terminate once on
+// shutdown: both wrap portaudio's own process-wide init/terminate.
+func Init() error {
+	return portaudio.Initialize()
+}
+
+func Terminate() error {
+	return portaudio.Terminate()
+}
+
+// HostAPIs enumerates the host APIs and devices portaudio can see, for
+// diagnostics. Init must have been called first.
+func HostAPIs() ([]*portaudio.HostApiInfo, error) {
+	return portaudio.HostApis()
+}
+
+// Capturer owns an open portaudio input stream for the configured device.
+type Capturer struct {
+	channels int
+	// SampleRate is the resolved capture rate: cfg.SampleRate, or defaultSampleRate
+	SampleRate int
+
+	stream       *portaudio.Stream
+	nativeBuffer interface{}
+	frame        []int16
+}
+
+// New resolves the configured input device and opens (but does not yet
+// start) a portaudio stream for it. Init must have been called first.
+func New(cfg config.AudioInputConfig) (*Capturer, error) {
+	hostAPIs, err := portaudio.HostApis()
+	if err != nil {
+		return nil, err
+	}
+
+	dev, err := resolveInputDevice(hostAPIs, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	channels := cfg.Channels
+	if channels == 0 {
+		channels = 1
+	}
+
+	sampleRate := cfg.SampleRate
+	if sampleRate == 0 {
+		sampleRate = defaultSampleRate
+	}
+
+	nativeBuffer, err := newNativeBuffer(cfg.SampleFormat, SamplesCount*channels)
+	if err != nil {
+		return nil, err
+	}
+
+	params := portaudio.StreamParameters{
+		Input: portaudio.StreamDeviceParameters{
+			Device:   dev,
+			Channels: channels,
+			Latency:  dev.DefaultLowInputLatency,
+		},
+		SampleRate:      float64(sampleRate),
+		FramesPerBuffer: SamplesCount,
+	}
+
+	log.Printf("Open sound input device: %s", dev.Name)
+	stream, err := portaudio.OpenStream(params, nativeBuffer)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Capturer{
+		channels:     channels,
+		SampleRate:   sampleRate,
+		stream:       stream,
+		nativeBuffer: nativeBuffer,
+		frame:        make([]int16, SamplesCount),
+	}, nil
+}
+
+// Run starts the stream and calls onFrame with every captured mono int16
+// frame, until ctx is canceled or either the stream or onFrame returns an
+// error. onFrame must not retain frame past its call, Run reuses it.
+func (c *Capturer) Run(ctx context.Context, onFrame func(frame []int16) error) error {
+	log.Printf("Start listening")
+	if err := c.stream.Start(); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+
+		if err := c.stream.Read(); err != nil {
+			return err
+		}
+
+		downmixToInt16(c.nativeBuffer, c.channels, c.frame)
+
+		if err := onFrame(c.frame); err != nil {
+			return err
+		}
+	}
+}
+
+// Close stops and releases the underlying portaudio stream.
+func (c *Capturer) Close() error {
+	if err := c.stream.Stop(); err != nil {
+		return err
+	}
+	return c.stream.Close()
+}
+
+// resolveInputDevice matches the configured host API/device name substrings
+// against the enumerated host APIs, falling back to the default input device
+// with a clear log message when nothing matches.
+func resolveInputDevice(hostApis []*portaudio.HostApiInfo, cfg config.AudioInputConfig) (*portaudio.DeviceInfo, error) {
+	for _, hs := range hostApis {
+		if cfg.HostApi != "" && !strings.Contains(strings.ToLower(hs.Name), strings.ToLower(cfg.HostApi)) {
+			continue
+		}
+		for _, d := range hs.Devices {
+			if d.MaxInputChannels == 0 {
+				continue
+			}
+			if cfg.Device != "" && !strings.Contains(strings.ToLower(d.Name), strings.ToLower(cfg.Device)) {
+				continue
+			}
+			log.Println("Using audio input device:", d.Name, "on host API", hs.Name)
+			return d, nil
+		}
+	}
+
+	if cfg.HostApi != "" || cfg.Device != "" {
+		log.Println("Requested audio input device not found, falling back to the default input device")
+	}
+
+	defHost, err := portaudio.DefaultHostApi()
+	if err != nil {
+		return nil, err
+	}
+	if defHost.DefaultInputDevice == nil {
+		return nil, fmt.Errorf("no default input device available")
+	}
+
+	log.Println("Using default audio input device:", defHost.DefaultInputDevice.Name)
+	return defHost.DefaultInputDevice, nil
+}
+
+// newNativeBuffer allocates the capture buffer in whatever format portaudio
+// should fill; its concrete Go type is how the gordonklaus/portaudio package
+// infers the stream's sample format.
+func newNativeBuffer(format string, size int) (interface{}, error) {
+	switch format {
+	case "", "int16":
+		return make([]int16, size), nil
+	case "int32":
+		return make([]int32, size), nil
+	case "float32":
+		return make([]float32, size), nil
+	default:
+		return nil, fmt.Errorf("unknown audio_input sample_format %q", format)
+	}
+}
+
+// downmixToInt16 averages every channel of the native capture buffer into a
+// mono int16 frame, regardless of the native sample format.
+func downmixToInt16(native interface{}, channels int, out []int16) {
+	for i := range out {
+		var sum float64
+		for ch := 0; ch < channels; ch++ {
+			sum += nativeSample(native, i*channels+ch)
+		}
+		mono := sum / float64(channels)
+
+		switch {
+		case mono > 1:
+			mono = 1
+		case mono < -1:
+			mono = -1
+		}
+		out[i] = int16(mono * math.MaxInt16)
+	}
+}
+
+// nativeSample returns sample i of the native capture buffer as a float64 in [-1, 1].
+func nativeSample(native interface{}, i int) float64 {
+	switch buf := native.(type) {
+	case []int16:
+		return float64(buf[i]) / math.MaxInt16
+	case []int32:
+		return float64(buf[i]) / (1<<31 - 1)
+	case []float32:
+		return float64(buf[i])
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,139 @@
+// Package config loads babymonitor's JSON configuration file into typed
+// structs, one sub-struct per subsystem (mounts, actions, audio input, level
+// trigger), so each pkg/* subsystem can take only the slice it needs.
+package config
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+)
+
+type Config struct {
+	FFmpegArgs string         `json:"ffmpeg_args"`
+	Actions    []ActionConfig `json:"actions"`
+	HttpPort   int            `json:"http_port"`
+
+	DebugMp3 struct {
+		Enabled  bool   `json:"enabled"`
+		Filename string `json:"filename"`
+	} `json:"debug_mp3"`
+
+	DebugWav struct {
+		Enabled  bool   `json:"enabled"`
+		Filename string `json:"filename"`
+	} `json:"debug_wav"`
+
+	LevelTrigger LevelTriggerConfig `json:"level_trigger"`
+
+	// Time to wait before the trigger can be enabled again
+	TriggerPauseSec int64 `json:"trigger_pause_sec"`
+
+	Mp3LameQuality int `json:"mp3_lame_quality"`
+
+	// PublicUrl is the base URL babymonitor is reachable at from wherever
+	// trigger actions run, e.g. "http://192.168.1.10:8080". When set, a
+	// fired trigger's ActionEvent.ClipUrl points at a pre-roll clip served
+	// off the first configured mount; left empty, ClipUrl is omitted.
+	PublicUrl string `json:"public_url"`
+
+	// Mounts lists every streaming endpoint to expose, e.g. /stream.mp3 (lame)
+	// or /stream.wav (raw PCM/L16), each fed from the same PCM capture. If
+	// empty, a single default mp3 mount is exposed on /stream.
+	Mounts []MountConfig `json:"mounts"`
+
+	AudioInput AudioInputConfig `json:"audio_input"`
+}
+
+type LevelTriggerConfig struct {
+	MeasureTime int `json:"measure_time_ms"`
+
+	// ThresholdOnDb/ThresholdOffDb are dBFS RMS levels forming a hysteresis
+	// band: the trigger arms once RMS has stayed >= ThresholdOnDb for
+	// AttackMs, and disarms once RMS has stayed < ThresholdOffDb for
+	// ReleaseMs. Set ThresholdOffDb a few dB below ThresholdOnDb to avoid
+	// chattering around a single threshold.
+	ThresholdOnDb  float64 `json:"threshold_on_db"`
+	ThresholdOffDb float64 `json:"threshold_off_db"`
+	AttackMs       int     `json:"attack_ms"`
+	ReleaseMs      int     `json:"release_ms"`
+
+	// AWeighting filters the PCM through an A-weighting curve before RMS/peak
+	// measurement, so the trigger follows perceived loudness instead of raw
+	// signal energy.
+	AWeighting bool `json:"a_weighting"`
+}
+
+type AudioInputConfig struct {
+	// HostApi and Device are matched as a case-insensitive substring against
+	// the host APIs/devices portaudio.HostApis() enumerates. Left empty, the
+	// default input device is used.
+	HostApi string `json:"host_api"`
+	Device  string `json:"device"`
+
+	SampleRate int `json:"sample_rate"`
+	Channels   int `json:"channels"`
+
+	// SampleFormat is the format to capture in: int16 (default), int32 or
+	// float32. Whatever is captured is downmixed to mono int16 before being
+	// fed to the rest of the pipeline.
+	SampleFormat string `json:"sample_format"`
+}
+
+type MountConfig struct {
+	Path          string `json:"path"`
+	Codec         string `json:"codec"` // mp3 or wav
+	Bitrate       int    `json:"bitrate"`
+	SampleRate    int    `json:"sample_rate"`
+	RingBufferSec int    `json:"ring_buffer_sec"`
+
+	Name  string `json:"name"`
+	Genre string `json:"genre"`
+	Url   string `json:"url"`
+}
+
+type ActionConfig struct {
+	// Driver selects which Action implementation to use: http (default),
+	// https-hmac, mqtt, exec or file.
+	Driver string `json:"driver"`
+
+	// http and https-hmac
+	Url     string `json:"url"`
+	Type    string `json:"type"` //HTTP method, e.g. POST
+	Payload string `json:"payload"`
+	Secret  string `json:"secret"` //https-hmac: key used to sign the payload
+
+	// mqtt
+	Broker string `json:"broker"`
+	Topic  string `json:"topic"`
+
+	// exec
+	Command string `json:"command"`
+
+	// file
+	Filename string `json:"filename"`
+}
+
+// Load reads and unmarshals a config file, defaulting Mounts to a single
+// mp3 mount on /stream when none are configured.
+func Load(path string) (*Config, error) {
+	log.Println("Reading config from", path)
+
+	cfile, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{}
+	if err := json.Unmarshal(cfile, cfg); err != nil {
+		return nil, err
+	}
+
+	if len(cfg.Mounts) == 0 {
+		cfg.Mounts = []MountConfig{
+			{Path: "/stream", Codec: "mp3"},
+		}
+	}
+
+	return cfg, nil
+}
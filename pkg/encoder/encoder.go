@@ -0,0 +1,90 @@
+// Package encoder builds the mono PCM16 encoders babymonitor streams and
+// records with (mp3/lame, wav/L16) behind one common interface.
+package encoder
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/raoulh/babymonitor/lame"
+	"github.com/zenwerk/go-wave"
+)
+
+// Params configures the encoder built by New. A zero SampleRate/Bitrate means
+// "use the codec's own default".
+type Params struct {
+	SampleRate int
+	Bitrate    int //kbps
+	Quality    int //lame quality; mp3 only
+}
+
+// Encoder is a mono PCM16 encoder writing compressed frames to its
+// underlying io.Writer, along with the Content-Type its output should be
+// served as.
+type Encoder interface {
+	io.WriteCloser
+	ContentType() string
+
+	// SupportsInterleavedMetadata reports whether frames of this codec can
+	// have out-of-band metadata (e.g. ICY) spliced into the byte stream
+	// between them without a client losing sync: true for framed codecs
+	// like mp3, whose decoders resync on the next frame sync word; false
+	// for codecs with no such framing, like raw PCM/wav, where splicing in
+	// extra bytes corrupts the rest of the stream.
+	SupportsInterleavedMetadata() bool
+}
+
+// New builds the Encoder for codec ("", "mp3" or "wav"), writing its
+// encoded output to out.
+//
+// opus and flac are not supported yet: there is no vendored encoder for
+// either codec, so requesting them fails at New rather than pretending to
+// work and panicking at the first Write.
+func New(codec string, out io.Writer, params Params) (Encoder, error) {
+	switch codec {
+	case "", "mp3":
+		w := lame.NewWriter(out)
+		w.Encoder.SetNumChannels(1)
+		w.Encoder.SetInSamplerate(params.SampleRate)
+		w.Encoder.SetMode(lame.MONO)
+		w.Encoder.SetQuality(params.Quality)
+		if params.Bitrate > 0 {
+			w.Encoder.SetBitrate(params.Bitrate)
+		}
+		w.Encoder.InitParams()
+		return &mp3Encoder{w}, nil
+
+	case "wav":
+		//raw PCM/L16: the WAV header's data size is written up-front and
+		//will be wrong since the stream never ends, but every browser and
+		//player we've tried plays it fine regardless
+		ww, err := wave.NewWriter(wave.WriterParam{
+			Out:           out,
+			Channel:       1,
+			SampleRate:    params.SampleRate,
+			BitsPerSample: 16,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &wavEncoder{ww}, nil
+
+	case "opus", "flac":
+		return nil, fmt.Errorf("codec %q is not supported yet", codec)
+
+	default:
+		return nil, fmt.Errorf("unknown codec %q", codec)
+	}
+}
+
+type mp3Encoder struct{ *lame.LameWriter }
+
+func (*mp3Encoder) ContentType() string { return "audio/mpeg" }
+
+func (*mp3Encoder) SupportsInterleavedMetadata() bool { return true }
+
+type wavEncoder struct{ *wave.Writer }
+
+func (*wavEncoder) ContentType() string { return "audio/wav" }
+
+func (*wavEncoder) SupportsInterleavedMetadata() bool { return false }
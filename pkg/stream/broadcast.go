@@ -0,0 +1,107 @@
+package stream
+
+import (
+	"log"
+	"sync"
+)
+
+// clientFrameBuffer is how many encoded frames a client channel can hold
+// before the client is considered too slow and is dropped
+const clientFrameBuffer = 64
+
+// frameBroadcaster fans out the encoded frames produced by a mount's encoder
+// to every subscribed client, and keeps a bounded ring buffer of the most
+// recent frames so new clients can fast-start with the context around them
+// instead of joining mid-stream. A client whose channel fills up (too slow
+// to keep up) is dropped instead of blocking the write that feeds the
+// encoder, which otherwise would stall the audio capture loop.
+type frameBroadcaster struct {
+	mutex sync.Mutex
+
+	ring         [][]byte
+	ringBytes    int
+	maxRingBytes int
+
+	subscribers map[*client]chan []byte
+}
+
+func newFrameBroadcaster(maxRingBytes int) *frameBroadcaster {
+	return &frameBroadcaster{
+		maxRingBytes: maxRingBytes,
+		subscribers:  make(map[*client]chan []byte),
+	}
+}
+
+// Write implements io.Writer so the mount's encoder can write straight into
+// the broadcaster.
+func (b *frameBroadcaster) Write(p []byte) (int, error) {
+	frame := make([]byte, len(p))
+	copy(frame, p)
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.ring = append(b.ring, frame)
+	b.ringBytes += len(frame)
+	for b.ringBytes > b.maxRingBytes && len(b.ring) > 0 {
+		b.ringBytes -= len(b.ring[0])
+		b.ring = b.ring[1:]
+	}
+
+	for c, ch := range b.subscribers {
+		select {
+		case ch <- frame:
+		default:
+			log.Println("Client too slow to keep up, dropping it")
+			delete(b.subscribers, c)
+			close(ch)
+			select {
+			case c.chanEnd <- true:
+			default:
+			}
+		}
+	}
+
+	return len(p), nil
+}
+
+// subscribe registers a new client and returns a copy of the current ring
+// buffer tail so the caller can flush it to the client before forwarding
+// live frames from the returned channel.
+func (b *frameBroadcaster) subscribe(c *client) (tail [][]byte, frames chan []byte) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	tail = make([][]byte, len(b.ring))
+	copy(tail, b.ring)
+
+	frames = make(chan []byte, clientFrameBuffer)
+	b.subscribers[c] = frames
+
+	return
+}
+
+// tail concatenates the current ring buffer into a single byte slice, for
+// serving as a standalone clip rather than flushing it to a subscribing
+// client.
+func (b *frameBroadcaster) tail() []byte {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	clip := make([]byte, 0, b.ringBytes)
+	for _, frame := range b.ring {
+		clip = append(clip, frame...)
+	}
+
+	return clip
+}
+
+func (b *frameBroadcaster) unsubscribe(c *client) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if ch, ok := b.subscribers[c]; ok {
+		delete(b.subscribers, c)
+		close(ch)
+	}
+}
@@ -0,0 +1,71 @@
+package stream
+
+import (
+	"fmt"
+	"io"
+)
+
+// icyMetaint is the number of mp3 bytes between two icy metadata blocks, as
+// sent in the icy-metaint header
+const icyMetaint = 8192
+
+// icyMetaMaxPayload is the max length of an icy metadata payload (255*16)
+const icyMetaMaxPayload = 4080
+
+// icyMetadataWriter wraps the http.ResponseWriter and injects Shoutcast/Icecast
+// in-band metadata blocks every icyMetaint bytes of the mp3 stream it forwards.
+// It sits between the encoder output and the HTTP response.
+type icyMetadataWriter struct {
+	w         io.Writer
+	metaint   int
+	count     int
+	streamUrl string
+	title     func() string
+}
+
+func newIcyMetadataWriter(w io.Writer, metaint int, streamUrl string, title func() string) *icyMetadataWriter {
+	return &icyMetadataWriter{w: w, metaint: metaint, streamUrl: streamUrl, title: title}
+}
+
+func (i *icyMetadataWriter) Write(p []byte) (written int, err error) {
+	for len(p) > 0 {
+		remaining := i.metaint - i.count
+		if len(p) < remaining {
+			n, err := i.w.Write(p)
+			written += n
+			i.count += n
+			return written, err
+		}
+
+		n, err := i.w.Write(p[:remaining])
+		written += n
+		i.count += n
+		if err != nil {
+			return written, err
+		}
+		p = p[remaining:]
+
+		if _, err := i.w.Write(i.metadataBlock()); err != nil {
+			return written, err
+		}
+		i.count = 0
+	}
+	return written, nil
+}
+
+// metadataBlock builds a Shoutcast metadata block for the current stream
+// title: a length byte (payload size / 16, rounded up) followed by the
+// payload, zero-padded to a multiple of 16 bytes.
+func (i *icyMetadataWriter) metadataBlock() []byte {
+	payload := fmt.Sprintf("StreamTitle='%s';StreamUrl='%s';", i.title(), i.streamUrl)
+	if len(payload) > icyMetaMaxPayload {
+		payload = payload[:icyMetaMaxPayload]
+	}
+
+	lengthByte := byte((len(payload) + 15) / 16)
+	block := make([]byte, 1+int(lengthByte)*16)
+	block[0] = lengthByte
+	copy(block[1:], payload)
+
+	return block
+}
@@ -0,0 +1,110 @@
+package stream
+
+import (
+	"encoding/binary"
+	"log"
+
+	"github.com/raoulh/babymonitor/pkg/config"
+	"github.com/raoulh/babymonitor/pkg/encoder"
+)
+
+// defaultRingBufferSec is used when a mount's ring_buffer_sec is not set
+const defaultRingBufferSec = 10
+
+// defaultBitrateKbps is used to size a compressed mount's ring buffer when
+// its bitrate is not set
+const defaultBitrateKbps = 128
+
+// pcmBytesPerSample is the size of one mono PCM16 sample, as produced by
+// the wav codec
+const pcmBytesPerSample = 2
+
+// mountPCMBuffer is how many PCM frames a mount's encoder goroutine can
+// queue before frames are dropped for that mount, so a slow encoder can
+// never stall the audio capture loop or other mounts
+const mountPCMBuffer = 64
+
+// mount exposes the same PCM capture under one URL in one encoding. It owns
+// its own encoder, ring buffer and client list so that mounts never block
+// each other: a slow encoder on one mount can't hold up another mount or the
+// caller feeding PCM frames in.
+type mount struct {
+	cfg config.MountConfig
+
+	broadcast *frameBroadcaster
+	encoder   encoder.Encoder
+
+	pcm chan []int16
+}
+
+func newMount(cfg config.MountConfig, sampleRate int) (*mount, error) {
+	ringBufferSec := cfg.RingBufferSec
+	if ringBufferSec == 0 {
+		ringBufferSec = defaultRingBufferSec
+	}
+	sr := cfg.SampleRate
+	if sr == 0 {
+		sr = sampleRate
+	}
+
+	m := &mount{
+		cfg:       cfg,
+		broadcast: newFrameBroadcaster(ringBufferBytes(cfg.Codec, sr, cfg.Bitrate) * ringBufferSec),
+		pcm:       make(chan []int16, mountPCMBuffer),
+	}
+
+	enc, err := encoder.New(cfg.Codec, m.broadcast, encoder.Params{SampleRate: sr, Bitrate: cfg.Bitrate})
+	if err != nil {
+		return nil, err
+	}
+	m.encoder = enc
+
+	return m, nil
+}
+
+// ringBufferBytes estimates codec's steady-state output byte rate, for
+// sizing a ring buffer that must hold a fixed span of encoded audio. wav is
+// uncompressed, so its byte rate comes straight from the PCM sample rate
+// rather than bitrateKbps, which doesn't apply to it; bitrateKbps falls
+// back to defaultBitrateKbps for every other (compressed) codec when unset.
+func ringBufferBytes(codec string, sampleRate, bitrateKbps int) int {
+	if codec == "wav" {
+		return sampleRate * pcmBytesPerSample
+	}
+
+	if bitrateKbps == 0 {
+		bitrateKbps = defaultBitrateKbps
+	}
+	return bitrateKbps * 1000 / 8
+}
+
+// run encodes PCM frames into the mount's broadcaster until the mount is
+// torn down. It must run in its own goroutine so a slow codec never blocks
+// the caller feeding PCM frames in.
+func (m *mount) run() {
+	for pcm := range m.pcm {
+		if err := binary.Write(m.encoder, binary.LittleEndian, pcm); err != nil {
+			log.Println("Failed to encode for mount", m.cfg.Path, err)
+		}
+	}
+}
+
+// writePCM hands off a copy of the frame to the mount's encoder goroutine.
+// If the mount can't keep up, the frame is dropped instead of blocking the
+// caller.
+func (m *mount) writePCM(frame []int16) {
+	cp := make([]int16, len(frame))
+	copy(cp, frame)
+
+	select {
+	case m.pcm <- cp:
+	default:
+		log.Println("Mount", m.cfg.Path, "too slow, dropping frame")
+	}
+}
+
+// close stops the mount's encoder goroutine and closes its encoder.
+func (m *mount) close() error {
+	close(m.pcm)
+	return m.encoder.Close()
+}
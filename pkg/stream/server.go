@@ -0,0 +1,300 @@
+// Package stream exposes the captured audio over HTTP: one Mount per
+// configured codec, each with its own encoder, ring buffer and client list,
+// fanned out from the same PCM capture, plus Icecast/Shoutcast-compatible
+// ICY metadata and fast-start for joining clients.
+package stream
+
+import (
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"golang.org/x/net/context"
+
+	"github.com/raoulh/babymonitor/pkg/config"
+)
+
+const serverUA = "Babymonitor/1.0"
+
+// client is one connected HTTP streaming client of a single mount.
+type client struct {
+	out io.Writer //where encoded frames are written: the response, or an icyMetadataWriter wrapping it
+
+	chanFrames chan []byte //encoded frames subscribed from its mount's encoder
+	chanEnd    chan bool
+}
+
+// pumpFrames writes every frame subscribed from the mount's encoder to the
+// client until its channel is closed (unsubscribed) or the write fails.
+func (c *client) pumpFrames() {
+	for frame := range c.chanFrames {
+		if _, err := c.out.Write(frame); err != nil {
+			log.Println("Failed to write data to client", err)
+			select {
+			case c.chanEnd <- true:
+			default:
+			}
+			return
+		}
+	}
+}
+
+// Server owns every streaming mount and the HTTP endpoints that serve them.
+// It is fed PCM frames by the caller (normally pkg/audio's capture loop)
+// via WritePCM, and serves them to HTTP clients in whichever codecs the
+// mounts were configured with.
+type Server struct {
+	httpPort  int
+	publicUrl string
+	mounts    map[string]*mount
+
+	// primaryPath is the first configured mount's path, used as the clip
+	// source for ClipURL
+	primaryPath string
+
+	mutexClients sync.Mutex
+	clients      map[*http.Request]*client
+
+	mutexTitle sync.Mutex
+	title      string
+
+	srv *http.Server
+}
+
+// New builds a Server with one mount per entry in mounts, each with its own
+// encoder and ring buffer, defaulting to sampleRate when a mount doesn't set
+// its own. publicUrl is the base URL the server is reachable at from
+// wherever trigger actions run; see ClipURL.
+func New(mounts []config.MountConfig, sampleRate int, httpPort int, publicUrl string) (*Server, error) {
+	s := &Server{
+		httpPort:  httpPort,
+		publicUrl: publicUrl,
+		mounts:    make(map[string]*mount, len(mounts)),
+		clients:   make(map[*http.Request]*client),
+	}
+
+	for i, mc := range mounts {
+		m, err := newMount(mc, sampleRate)
+		if err != nil {
+			return nil, err
+		}
+		s.mounts[mc.Path] = m
+		if i == 0 {
+			s.primaryPath = mc.Path
+		}
+	}
+
+	return s, nil
+}
+
+// Run starts every mount's encoder goroutine and the HTTP server, and blocks
+// until ctx is canceled, at which point it releases every connected client,
+// stops every mount and shuts the HTTP server down.
+func (s *Server) Run(ctx context.Context) error {
+	for _, m := range s.mounts {
+		go m.run()
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	for _, m := range s.mounts {
+		log.Println("Exposing mount", m.cfg.Path, "as", m.encoder.ContentType())
+		mux.Handle(m.cfg.Path, s.mountHandler(m))
+		mux.Handle(m.cfg.Path+"/clip", s.clipHandler(m))
+	}
+	mux.Handle("/settitle", s.setTitleHandler())
+
+	s.srv = &http.Server{Addr: ":" + strconv.Itoa(s.httpPort), Handler: mux}
+
+	go func() {
+		log.Println("Starting HTTP server, port", s.httpPort)
+		if err := s.srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("Httpserver: ListenAndServe() error: %s", err)
+		}
+	}()
+
+	<-ctx.Done()
+
+	return s.close()
+}
+
+// WritePCM fans a captured PCM frame out to every mount's encoder. Safe to
+// call before Run's HTTP server is up; it only feeds the mounts' encoders.
+func (s *Server) WritePCM(frame []int16) {
+	for _, m := range s.mounts {
+		m.writePCM(frame)
+	}
+}
+
+// SetTitle updates the Icy-MetaData title broadcast to every mount's
+// clients, e.g. to announce "Alert!" when a level trigger fires.
+func (s *Server) SetTitle(title string) {
+	s.mutexTitle.Lock()
+	s.title = title
+	s.mutexTitle.Unlock()
+}
+
+func (s *Server) getTitle() string {
+	s.mutexTitle.Lock()
+	defer s.mutexTitle.Unlock()
+	return s.title
+}
+
+// ClipURL returns the URL of a short pre-roll clip around the current
+// moment, suitable for passing to trigger.ActionEvent.ClipUrl, or "" if no
+// publicUrl was configured or no mount exists to clip from.
+func (s *Server) ClipURL() string {
+	if s.publicUrl == "" || s.primaryPath == "" {
+		return ""
+	}
+
+	return s.publicUrl + s.primaryPath + "/clip"
+}
+
+// close releases every connected client, stops every mount's encoder and
+// shuts down the HTTP server.
+func (s *Server) close() error {
+	s.mutexClients.Lock()
+	for _, c := range s.clients {
+		select {
+		case c.chanEnd <- true:
+		default:
+		}
+	}
+	s.mutexClients.Unlock()
+
+	for _, m := range s.mounts {
+		if err := m.close(); err != nil {
+			log.Println("Failed to close mount", m.cfg.Path, err)
+		}
+	}
+
+	if s.srv == nil {
+		return nil
+	}
+
+	shutdownCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	return s.srv.Shutdown(shutdownCtx)
+}
+
+// mountHandler serves the streaming endpoint for a single mount: it
+// subscribes the client to the mount's broadcaster, flushes the ring buffer
+// tail for a fast start, then forwards live frames until the client
+// disconnects or falls behind.
+func (s *Server) mountHandler(m *mount) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			//Use default go serve handler
+			http.DefaultServeMux.ServeHTTP(w, r)
+			return
+		}
+
+		log.Println("New client for mount", m.cfg.Path, ":", r.RemoteAddr)
+
+		//Splicing ICY metadata into a codec with no frame sync to resync on
+		//(e.g. raw PCM/wav) corrupts the rest of the stream for that client,
+		//so only honor the request on codecs that can tolerate it
+		icyRequested := r.Header.Get("Icy-MetaData") == "1" && m.encoder.SupportsInterleavedMetadata()
+
+		w.Header().Set("Server", serverUA)
+		w.Header().Set("Content-Type", m.encoder.ContentType())
+		w.Header().Set("icy-name", m.cfg.Name)
+		w.Header().Set("icy-genre", m.cfg.Genre)
+		w.Header().Set("icy-url", m.cfg.Url)
+		w.Header().Set("icy-br", strconv.Itoa(m.cfg.Bitrate))
+		w.Header().Set("icy-pub", "0")
+		if icyRequested {
+			w.Header().Set("icy-metaint", strconv.Itoa(icyMetaint))
+		}
+		w.WriteHeader(201)
+
+		c := &client{
+			out:     w,
+			chanEnd: make(chan bool, 1),
+		}
+		if icyRequested {
+			c.out = newIcyMetadataWriter(w, icyMetaint, m.cfg.Url, s.getTitle)
+		}
+
+		//Subscribe to the mount's encoder and immediately flush the buffered
+		//tail, so the client hears the context around a trigger event instead
+		//of joining mid-stream
+		tail, frames := m.broadcast.subscribe(c)
+		c.chanFrames = frames
+
+		s.mutexClients.Lock()
+		s.clients[r] = c
+		s.mutexClients.Unlock()
+
+		for _, frame := range tail {
+			if _, err := c.out.Write(frame); err != nil {
+				log.Println("Failed to flush ring buffer to client", err)
+				m.broadcast.unsubscribe(c)
+				c.chanEnd <- true
+				break
+			}
+		}
+
+		go c.pumpFrames()
+
+		//Wait for an eventual end from writer.
+		//If client closes the connection a write error will occur
+		//If sound read/mp3 encode is failing, an error will occur
+		//and client will need to quit
+		<-c.chanEnd
+
+		m.broadcast.unsubscribe(c)
+
+		s.mutexClients.Lock()
+		delete(s.clients, r)
+		s.mutexClients.Unlock()
+
+		log.Println("Closing HTTP client:", r.RemoteAddr)
+	})
+}
+
+// clipHandler serves a one-shot snapshot of the mount's current ring
+// buffer: the same pre-roll audio a fast-starting client receives, but
+// downloadable on its own so a trigger action can link to "what was heard"
+// without joining the live stream.
+func (s *Server) clipHandler(m *mount) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.DefaultServeMux.ServeHTTP(w, r)
+			return
+		}
+
+		clip := m.broadcast.tail()
+
+		w.Header().Set("Server", serverUA)
+		w.Header().Set("Content-Type", m.encoder.ContentType())
+		w.Header().Set("Content-Length", strconv.Itoa(len(clip)))
+		w.Write(clip)
+	})
+}
+
+// setTitleHandler lets operators update the currently-broadcast icy metadata
+// title, e.g. POST /settitle with the new title as the request body.
+func (s *Server) setTitleHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.DefaultServeMux.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		s.SetTitle(string(body))
+		w.WriteHeader(http.StatusOK)
+	})
+}
@@ -0,0 +1,212 @@
+package trigger
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/raoulh/babymonitor/pkg/config"
+)
+
+// actionTimeout bounds how long a single Action.Fire call may run, so an
+// unreachable webhook, broker or a hung shell command can't leak its
+// goroutine for the life of the process.
+const actionTimeout = 30 * time.Second
+
+// ActionEvent carries the context of a level trigger to an Action.
+type ActionEvent struct {
+	Time time.Time
+
+	// Level and Peak are the RMS and peak level, in dBFS, measured over the
+	// triggering window
+	Level float64
+	Peak  float64
+
+	// ClipUrl points to a short pre-roll clip around the trigger, when available
+	ClipUrl string
+}
+
+// Action is a pluggable trigger driver: http, https-hmac, mqtt, exec or file.
+type Action interface {
+	Fire(ctx context.Context, event ActionEvent) error
+}
+
+func newAction(cfg config.ActionConfig) (Action, error) {
+	switch cfg.Driver {
+	case "", "http":
+		return &httpAction{url: cfg.Url, method: cfg.Type, payload: cfg.Payload}, nil
+
+	case "https-hmac":
+		return &hmacAction{url: cfg.Url, method: cfg.Type, payload: cfg.Payload, secret: cfg.Secret}, nil
+
+	case "mqtt":
+		return &mqttAction{broker: cfg.Broker, topic: cfg.Topic, payload: cfg.Payload}, nil
+
+	case "exec":
+		return &execAction{command: cfg.Command}, nil
+
+	case "file":
+		return &fileAction{filename: cfg.Filename}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown action driver %q", cfg.Driver)
+	}
+}
+
+func fireAction(a Action, event ActionEvent) {
+	ctx, cancel := context.WithTimeout(context.Background(), actionTimeout)
+	defer cancel()
+
+	if err := a.Fire(ctx, event); err != nil {
+		log.Println("Action failed:", err)
+	}
+}
+
+// httpAction calls a webhook URL, the original (and still default) action driver.
+type httpAction struct {
+	url     string
+	method  string
+	payload string
+}
+
+func (a *httpAction) Fire(ctx context.Context, event ActionEvent) error {
+	req, err := http.NewRequest(a.method, a.url, bytes.NewBufferString(a.payload))
+	if err != nil {
+		return err
+	}
+
+	return doActionRequest(ctx, req)
+}
+
+// hmacAction is an httpAction that signs its payload with an HMAC-SHA256
+// header, for webhook receivers that authenticate their callers.
+type hmacAction struct {
+	url     string
+	method  string
+	payload string
+	secret  string
+}
+
+func (a *hmacAction) Fire(ctx context.Context, event ActionEvent) error {
+	req, err := http.NewRequest(a.method, a.url, bytes.NewBufferString(a.payload))
+	if err != nil {
+		return err
+	}
+
+	mac := hmac.New(sha256.New, []byte(a.secret))
+	mac.Write([]byte(a.payload))
+	req.Header.Set("X-Signature-256", hex.EncodeToString(mac.Sum(nil)))
+
+	return doActionRequest(ctx, req)
+}
+
+func doActionRequest(ctx context.Context, req *http.Request) error {
+	log.Println("Call action:", req.URL)
+
+	//req's context already bounds the call (see fireAction); the client
+	//Timeout is a second line of defense in case that ever stops being true
+	client := &http.Client{Timeout: actionTimeout}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		log.Println("Failed to call request to", req.URL, err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	log.Println("Response Status:", resp.Status)
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("action request to %s failed with status %s", req.URL, resp.Status)
+	}
+
+	_, err = ioutil.ReadAll(resp.Body)
+	return err
+}
+
+// mqttAction publishes the trigger payload to a topic on a broker, for
+// smart-home integrations such as Home Assistant.
+type mqttAction struct {
+	broker  string
+	topic   string
+	payload string
+}
+
+func (a *mqttAction) Fire(ctx context.Context, event ActionEvent) error {
+	opts := mqtt.NewClientOptions().AddBroker(a.broker).SetConnectTimeout(actionTimeout)
+	client := mqtt.NewClient(opts)
+
+	//WaitTimeout, not Wait: an unreachable broker must not block this
+	//goroutine past actionTimeout
+	if token := client.Connect(); !token.WaitTimeout(actionTimeout) {
+		return fmt.Errorf("connecting to mqtt broker %s timed out", a.broker)
+	} else if token.Error() != nil {
+		return token.Error()
+	}
+	defer client.Disconnect(250)
+
+	token := client.Publish(a.topic, 0, false, a.payload)
+	if !token.WaitTimeout(actionTimeout) {
+		return fmt.Errorf("publishing to mqtt topic %s timed out", a.topic)
+	}
+	return token.Error()
+}
+
+// execAction runs a local command with the trigger metadata in env vars.
+type execAction struct {
+	command string
+}
+
+func (a *execAction) Fire(ctx context.Context, event ActionEvent) error {
+	cmd := exec.CommandContext(ctx, "sh", "-c", a.command)
+	cmd.Env = append(os.Environ(),
+		fmt.Sprintf("TRIGGER_TIME=%d", event.Time.Unix()),
+		fmt.Sprintf("TRIGGER_LEVEL=%f", event.Level),
+		fmt.Sprintf("TRIGGER_PEAK=%f", event.Peak),
+		fmt.Sprintf("TRIGGER_CLIP_URL=%s", event.ClipUrl),
+	)
+	return cmd.Run()
+}
+
+// fileAction appends a JSON event line to a file for later ingestion.
+type fileAction struct {
+	filename string
+
+	mutex sync.Mutex
+}
+
+func (a *fileAction) Fire(ctx context.Context, event ActionEvent) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	f, err := os.OpenFile(a.filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	line, err := json.Marshal(struct {
+		Time    time.Time `json:"time"`
+		Level   float64   `json:"level"`
+		Peak    float64   `json:"peak"`
+		ClipUrl string    `json:"clip_url,omitempty"`
+	}{event.Time, event.Level, event.Peak, event.ClipUrl})
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
@@ -0,0 +1,112 @@
+package trigger
+
+import "math"
+
+// Standard pole frequencies for the A-weighting curve (ANSI S1.42 / IEC 61672).
+const (
+	aWeightF1 = 20.598997057568145
+	aWeightF2 = 107.65264864304628
+	aWeightF3 = 737.8622307362899
+	aWeightF4 = 12194.21714799801
+)
+
+// firstOrderSection is one pole/zero of the cascaded IIR realization of the
+// A-weighting analog prototype, after a direct bilinear transform (no pole
+// prewarping, since the section corner frequencies are well below Nyquist for
+// any sample rate this pipeline supports).
+type firstOrderSection struct {
+	b0, b1, a1      float64
+	prevIn, prevOut float64
+}
+
+func (s *firstOrderSection) process(x float64) float64 {
+	y := s.b0*x + s.b1*s.prevIn - s.a1*s.prevOut
+	s.prevIn = x
+	s.prevOut = y
+	return y
+}
+
+// magnitude returns |H(e^jw)| for this section at angular frequency omega,
+// without touching the running filter state.
+func (s *firstOrderSection) magnitude(omega float64) float64 {
+	zr, zi := math.Cos(-omega), math.Sin(-omega) //z^-1 = e^-jw
+
+	numR, numI := s.b0+s.b1*zr, s.b1*zi
+	denR, denI := 1+s.a1*zr, s.a1*zi
+
+	return math.Hypot(numR, numI) / math.Hypot(denR, denI)
+}
+
+// newHighpassSection bilinear-transforms the analog one-pole highpass
+// H(s) = s/(s+w) at the given corner frequency.
+func newHighpassSection(cornerHz, sampleRate float64) *firstOrderSection {
+	w := 2 * math.Pi * cornerHz
+	c := 2 * sampleRate
+	den := c + w
+
+	return &firstOrderSection{b0: c / den, b1: -c / den, a1: (w - c) / den}
+}
+
+// newLowpassSection bilinear-transforms the analog one-pole lowpass
+// H(s) = w/(s+w) at the given corner frequency.
+func newLowpassSection(cornerHz, sampleRate float64) *firstOrderSection {
+	w := 2 * math.Pi * cornerHz
+	c := 2 * sampleRate
+	den := c + w
+
+	return &firstOrderSection{b0: w / den, b1: w / den, a1: (w - c) / den}
+}
+
+// aWeightingFilter applies an A-weighting curve to int16 PCM, realized as six
+// cascaded first-order IIR sections (double highpass at f1, single highpass
+// at f2 and f3, double lowpass at f4), with gain normalized to 0dB at 1kHz.
+type aWeightingFilter struct {
+	sections []*firstOrderSection
+	gain     float64
+}
+
+func newAWeightingFilter(sampleRate float64) *aWeightingFilter {
+	f := &aWeightingFilter{
+		sections: []*firstOrderSection{
+			newHighpassSection(aWeightF1, sampleRate),
+			newHighpassSection(aWeightF1, sampleRate),
+			newHighpassSection(aWeightF2, sampleRate),
+			newHighpassSection(aWeightF3, sampleRate),
+			newLowpassSection(aWeightF4, sampleRate),
+			newLowpassSection(aWeightF4, sampleRate),
+		},
+	}
+
+	omega1k := 2 * math.Pi * 1000 / sampleRate
+	mag := 1.0
+	for _, s := range f.sections {
+		mag *= s.magnitude(omega1k)
+	}
+	f.gain = 1 / mag
+
+	return f
+}
+
+// processBuffer runs in through the filter, carrying state across calls so
+// consecutive analysis windows don't introduce boundary artifacts.
+func (f *aWeightingFilter) processBuffer(in []int16) []int16 {
+	out := make([]int16, len(in))
+
+	for i, v := range in {
+		y := float64(v) / math.MaxInt16
+		for _, s := range f.sections {
+			y = s.process(y)
+		}
+		y *= f.gain
+
+		if y > 1 {
+			y = 1
+		} else if y < -1 {
+			y = -1
+		}
+
+		out[i] = int16(y * math.MaxInt16)
+	}
+
+	return out
+}
@@ -0,0 +1,197 @@
+// Package trigger measures the captured audio level and fires a pluggable
+// set of Actions (http, https-hmac, mqtt, exec, file) when it has stayed
+// above a configured threshold for long enough.
+package trigger
+
+import (
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/raoulh/babymonitor/pkg/config"
+)
+
+// dbFloor is returned by linearToDb for a silent (zero) signal, standing in
+// for -Inf so callers can keep comparing against ordinary float thresholds.
+const dbFloor = -120.0
+
+// Detector measures RMS/peak level over fixed-size analysis windows and
+// fires the configured actions on the rising edge of an attack/release
+// hysteresis band, so a continuous cry keeps the trigger latched instead of
+// cooling down mid-cry. Feed it captured PCM via Process.
+type Detector struct {
+	cfg      config.LevelTriggerConfig
+	pauseSec int64
+
+	actions []Action
+
+	// clipURL returns the current pre-roll clip URL to attach to a fired
+	// event, or nil/"" if none is available
+	clipURL func() string
+
+	aWeight *aWeightingFilter
+
+	mutexBuff sync.Mutex
+	window    []int16
+	filled    int
+
+	mutexState sync.Mutex
+	triggered  bool
+	aboveSince time.Time
+	belowSince time.Time
+	lastFire   time.Time
+}
+
+// New sizes the analysis window to cfg.MeasureTime at sampleRate and builds
+// the actions described by actionCfgs. clipURL, if non-nil, is called to
+// populate each fired ActionEvent's ClipUrl.
+func New(cfg config.LevelTriggerConfig, actionCfgs []config.ActionConfig, pauseSec int64, sampleRate int, clipURL func() string) (*Detector, error) {
+	actions := make([]Action, 0, len(actionCfgs))
+	for _, ac := range actionCfgs {
+		a, err := newAction(ac)
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, a)
+	}
+
+	d := &Detector{
+		cfg:      cfg,
+		pauseSec: pauseSec,
+		actions:  actions,
+		clipURL:  clipURL,
+		window:   make([]int16, cfg.MeasureTime*sampleRate/1000),
+		//the pause cooldown shouldn't hold off the very first trigger
+		lastFire: time.Now().Add(-time.Duration(pauseSec) * time.Second),
+	}
+
+	if cfg.AWeighting {
+		d.aWeight = newAWeightingFilter(float64(sampleRate))
+	}
+
+	return d, nil
+}
+
+// Process accumulates a captured PCM frame into the current analysis
+// window, measuring it and firing actions asynchronously once the window
+// fills. Frames arriving while a window is still being measured are
+// dropped, so a slow action never stalls the caller.
+func (d *Detector) Process(frame []int16) {
+	d.mutexBuff.Lock()
+	defer d.mutexBuff.Unlock()
+
+	if d.filled >= len(d.window) {
+		//The window is already filled and another goroutine is measuring it;
+		//drop this frame
+		return
+	}
+
+	copy(d.window[d.filled:], frame)
+	d.filled += len(frame)
+
+	if d.filled >= len(d.window) {
+		window := make([]int16, len(d.window))
+		copy(window, d.window)
+		d.filled = 0
+		go d.check(window)
+	}
+}
+
+func (d *Detector) check(window []int16) {
+	samples := window
+	if d.aWeight != nil {
+		samples = d.aWeight.processBuffer(window)
+	}
+
+	rmsDb, peakDb := measureLevelsDb(samples)
+
+	if !d.evaluate(rmsDb) {
+		return
+	}
+
+	log.Println("Level triggered at", rmsDb, "dBFS RMS (peak", peakDb, "dBFS). Calling actions.")
+
+	event := ActionEvent{Time: time.Now(), Level: rmsDb, Peak: peakDb}
+	if d.clipURL != nil {
+		event.ClipUrl = d.clipURL()
+	}
+	for _, a := range d.actions {
+		go fireAction(a, event)
+	}
+}
+
+// evaluate feeds an RMS dBFS reading into the attack/release state machine
+// and reports whether this call is the rising edge that should fire
+// actions: rmsDb has stayed >= ThresholdOnDb for AttackMs, the trigger
+// wasn't already latched, and the pause cooldown since the last fire has
+// elapsed. It disarms once rmsDb has stayed below ThresholdOffDb for
+// ReleaseMs.
+func (d *Detector) evaluate(rmsDb float64) (fire bool) {
+	d.mutexState.Lock()
+	defer d.mutexState.Unlock()
+
+	now := time.Now()
+
+	switch {
+	case rmsDb >= d.cfg.ThresholdOnDb:
+		if d.aboveSince.IsZero() {
+			d.aboveSince = now
+		}
+		d.belowSince = time.Time{}
+	case rmsDb < d.cfg.ThresholdOffDb:
+		if d.belowSince.IsZero() {
+			d.belowSince = now
+		}
+		d.aboveSince = time.Time{}
+	default:
+		//Between the two thresholds: hold whichever timer is already running
+	}
+
+	attack := time.Duration(d.cfg.AttackMs) * time.Millisecond
+	release := time.Duration(d.cfg.ReleaseMs) * time.Millisecond
+	pause := time.Duration(d.pauseSec) * time.Second
+
+	if !d.triggered && !d.aboveSince.IsZero() && now.Sub(d.aboveSince) >= attack {
+		d.triggered = true
+		if now.Sub(d.lastFire) >= pause {
+			d.lastFire = now
+			fire = true
+		}
+	}
+
+	if d.triggered && !d.belowSince.IsZero() && now.Sub(d.belowSince) >= release {
+		d.triggered = false
+	}
+
+	return fire
+}
+
+// measureLevelsDb returns the RMS and peak level of samples, in dBFS.
+func measureLevelsDb(samples []int16) (rmsDb, peakDb float64) {
+	var sumSquares, peak float64
+	for _, v := range samples {
+		level := float64(v) / math.MaxInt16
+		sumSquares += level * level
+		if abs := math.Abs(level); abs > peak {
+			peak = abs
+		}
+	}
+
+	rms := math.Sqrt(sumSquares / float64(len(samples)))
+
+	return linearToDb(rms), linearToDb(peak)
+}
+
+func linearToDb(level float64) float64 {
+	if level <= 0 {
+		return dbFloor
+	}
+
+	db := 20 * math.Log10(level)
+	if db < dbFloor {
+		return dbFloor
+	}
+
+	return db
+}